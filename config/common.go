@@ -5,6 +5,7 @@ package config
 
 import (
 	"io"
+	"reflect"
 	"sync"
 
 	"github.com/mattermost/mattermost-server/model"
@@ -18,6 +19,7 @@ type commonStore struct {
 	configLock           sync.RWMutex
 	config               *model.Config
 	environmentOverrides map[string]interface{}
+	declarativeOverrides map[string]interface{}
 }
 
 // Get fetches the current, cached configuration.
@@ -36,6 +38,15 @@ func (cs *commonStore) GetEnvironmentOverrides() map[string]interface{} {
 	return cs.environmentOverrides
 }
 
+// GetDeclarativeOverrides fetches the configuration fields pinned by the declarative config
+// overlay (MM_CONFIG_OVERWRITE_JSON or MM_CONFIG_OVERWRITE_FILE).
+func (cs *commonStore) GetDeclarativeOverrides() map[string]interface{} {
+	cs.configLock.RLock()
+	defer cs.configLock.RUnlock()
+
+	return cs.declarativeOverrides
+}
+
 // set replaces the current configuration in its entirety, without updating the backing store.
 //
 // This function assumes no lock has been acquired, as it acquires a write lock itself.
@@ -71,6 +82,14 @@ func (cs *commonStore) set(newCfg *model.Config, isValid func(*model.Config) err
 		}
 	}
 
+	if oldCfg != nil {
+		for _, change := range diffConfigs(oldCfg, newCfg) {
+			if isPathOverridden(change.Path, cs.environmentOverrides) || isPathOverridden(change.Path, cs.declarativeOverrides) {
+				return nil, &ErrReadOnlyField{Path: change.Path}
+			}
+		}
+	}
+
 	// Ideally, Set would persist automatically and abstract this completely away from the
 	// client. Doing so requires a few upstream changes first, so for now an explicit Save()
 	// remains required.
@@ -82,9 +101,20 @@ func (cs *commonStore) set(newCfg *model.Config, isValid func(*model.Config) err
 
 	unlockOnce.Do(cs.configLock.Unlock)
 
-	// Notify listeners synchronously. Ideally, this would be asynchronous, but existing code
-	// assumes this and there would be increased complexity to avoid racing updates.
-	cs.invokeConfigListeners(oldCfg, newCfg)
+	// Listeners are dispatched asynchronously; only those marked Synchronous or Critical are
+	// waited on here, and a failure among the Critical ones rolls back the change. configLock is
+	// released for the duration of dispatch, so another Set/Load may have already moved
+	// cs.config on; only roll back if this call's newCfg is still the current one, to avoid
+	// clobbering that concurrent update.
+	if err := cs.invokeConfigListeners(oldCfg, newCfg); err != nil {
+		cs.configLock.Lock()
+		if cs.config == newCfg {
+			cs.config = oldCfg
+		}
+		cs.configLock.Unlock()
+
+		return nil, errors.Wrap(err, "configuration change rolled back")
+	}
 
 	return oldCfg, nil
 }
@@ -108,6 +138,19 @@ func (cs *commonStore) load(f io.ReadCloser, needsSave bool, persist func(*model
 
 	loadedCfg.SetDefaults()
 
+	overlay, err := loadDeclarativeOverlay()
+	if err != nil {
+		return errors.Wrap(err, "failed to load declarative config overlay")
+	}
+
+	var declarativeOverrides map[string]interface{}
+	if len(overlay) > 0 {
+		declarativeOverrides, err = applyDeclarativeOverlay(reflect.ValueOf(loadedCfg), overlay)
+		if err != nil {
+			return errors.Wrap(err, "failed to apply declarative config overlay")
+		}
+	}
+
 	if err := loadedCfg.IsValid(); err != nil {
 		return errors.Wrap(err, "invalid config")
 	}
@@ -129,12 +172,24 @@ func (cs *commonStore) load(f io.ReadCloser, needsSave bool, persist func(*model
 	oldCfg := cs.config
 	cs.config = loadedCfg
 	cs.environmentOverrides = environmentOverrides
+	cs.declarativeOverrides = declarativeOverrides
 
 	unlockOnce.Do(cs.configLock.Unlock)
 
-	// Notify listeners synchronously. Ideally, this would be asynchronous, but existing code
-	// assumes this and there would be increased complexity to avoid racing updates.
-	cs.invokeConfigListeners(oldCfg, loadedCfg)
+	// Listeners are dispatched asynchronously; only those marked Synchronous or Critical are
+	// waited on here, and a failure among the Critical ones rolls back the change. configLock is
+	// released for the duration of dispatch, so another Set/Load may have already moved
+	// cs.config on; only roll back if this call's loadedCfg is still the current one, to avoid
+	// clobbering that concurrent update.
+	if err := cs.invokeConfigListeners(oldCfg, loadedCfg); err != nil {
+		cs.configLock.Lock()
+		if cs.config == loadedCfg {
+			cs.config = oldCfg
+		}
+		cs.configLock.Unlock()
+
+		return errors.Wrap(err, "configuration load rolled back")
+	}
 
 	return nil
 }
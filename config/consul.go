@@ -0,0 +1,225 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+const consulDefaultKey = "mattermost/config"
+
+// ConsulStore is a config store backed by a single Consul KV key, suitable for deployments
+// that already run Consul and would rather not provision a database purely for early-boot
+// config.
+type ConsulStore struct {
+	commonStore
+
+	originalDsn string
+	key         string
+	client      *api.Client
+
+	modifyIndexMutex sync.Mutex
+	modifyIndex      uint64 // guarded by modifyIndexMutex; written by Load, read by watch
+
+	watchMutex sync.Mutex
+	watchStop  chan struct{}
+}
+
+func (cs *ConsulStore) getModifyIndex() uint64 {
+	cs.modifyIndexMutex.Lock()
+	defer cs.modifyIndexMutex.Unlock()
+
+	return cs.modifyIndex
+}
+
+func (cs *ConsulStore) setModifyIndex(modifyIndex uint64) {
+	cs.modifyIndexMutex.Lock()
+	defer cs.modifyIndexMutex.Unlock()
+
+	cs.modifyIndex = modifyIndex
+}
+
+// NewConsulStore creates a new instance of a config store backed by Consul.
+//
+// The DSN is of the form consul://host:port/path/to/key.
+func NewConsulStore(dsn string) (cs *ConsulStore, err error) {
+	address, key, err := parseConsulDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DSN")
+	}
+
+	clientConfig := api.DefaultConfig()
+	clientConfig.Address = address
+
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to consul")
+	}
+
+	cs = &ConsulStore{
+		originalDsn: dsn,
+		key:         key,
+		client:      client,
+	}
+
+	if err = cs.Load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load")
+	}
+
+	go cs.watch()
+
+	return cs, nil
+}
+
+// parseConsulDSN splits a consul DSN into its address and key.
+//
+// For example:
+//	consul://consul:8500/mattermost/config
+// returns
+//	address = "consul:8500"
+//	key = "mattermost/config"
+func parseConsulDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to parse DSN as URL")
+	}
+
+	if u.Scheme != "consul" {
+		return "", "", errors.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		key = consulDefaultKey
+	}
+
+	return u.Host, key, nil
+}
+
+// Set replaces the current configuration in its entirety, without updating the backing store.
+func (cs *ConsulStore) Set(newCfg *model.Config) (*model.Config, error) {
+	return cs.commonStore.set(newCfg, nil)
+}
+
+// persist writes the configuration to the configured Consul key.
+func (cs *ConsulStore) persist(cfg *model.Config) error {
+	b, err := marshalConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize")
+	}
+
+	kv := cs.client.KV()
+	pair := &api.KVPair{Key: cs.key, Value: b}
+	if _, err := kv.Put(pair, nil); err != nil {
+		return errors.Wrap(err, "failed to write configuration to consul")
+	}
+
+	return nil
+}
+
+// Load updates the current configuration from Consul.
+func (cs *ConsulStore) Load() (err error) {
+	var needsSave bool
+	var configurationData []byte
+
+	kv := cs.client.KV()
+	pair, _, err := kv.Get(cs.key, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to read configuration from consul")
+	}
+
+	if pair == nil {
+		needsSave = true
+
+		defaultCfg := model.Config{}
+		defaultCfg.SetDefaults()
+
+		configurationData, err = marshalConfig(&defaultCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to serialize default config")
+		}
+	} else {
+		configurationData = pair.Value
+		cs.setModifyIndex(pair.ModifyIndex)
+	}
+
+	return cs.commonStore.load(ioutil.NopCloser(bytes.NewReader(configurationData)), needsSave, cs.persist)
+}
+
+// Save writes the current configuration to Consul.
+func (cs *ConsulStore) Save() error {
+	cs.configLock.RLock()
+	defer cs.configLock.RUnlock()
+
+	return cs.persist(cs.config)
+}
+
+// String returns the DSN of the consul store, masking any embedded credentials.
+func (cs *ConsulStore) String() string {
+	u, _ := url.Parse(cs.originalDsn)
+
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+
+	return u.String()
+}
+
+// Close cleans up resources associated with the store.
+func (cs *ConsulStore) Close() error {
+	cs.watchMutex.Lock()
+	if cs.watchStop != nil {
+		close(cs.watchStop)
+		cs.watchStop = nil
+	}
+	cs.watchMutex.Unlock()
+
+	return nil
+}
+
+// watch uses Consul's native blocking queries to reload the configuration whenever another
+// node updates it, driving invokeConfigListeners via Load.
+func (cs *ConsulStore) watch() {
+	stop := make(chan struct{})
+
+	cs.watchMutex.Lock()
+	cs.watchStop = stop
+	cs.watchMutex.Unlock()
+
+	kv := cs.client.KV()
+	waitIndex := cs.getModifyIndex()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		pair, meta, err := kv.Get(cs.key, &api.QueryOptions{WaitIndex: waitIndex, WaitTime: 0})
+		if err != nil {
+			mlog.Error("Failed to watch consul for configuration changes", mlog.Err(err))
+			continue
+		}
+
+		if pair != nil && pair.ModifyIndex > waitIndex {
+			waitIndex = pair.ModifyIndex
+			if err := cs.Load(); err != nil {
+				mlog.Error("Failed to reload configuration after consul watch event", mlog.Err(err))
+			}
+		} else if meta != nil {
+			waitIndex = meta.LastIndex
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConsulDSN(t *testing.T) {
+	t.Run("explicit key", func(t *testing.T) {
+		address, key, err := parseConsulDSN("consul://consul:8500/mattermost/config")
+		require.NoError(t, err)
+		require.Equal(t, "consul:8500", address)
+		require.Equal(t, "mattermost/config", key)
+	})
+
+	t.Run("missing key falls back to the default", func(t *testing.T) {
+		address, key, err := parseConsulDSN("consul://consul:8500")
+		require.NoError(t, err)
+		require.Equal(t, "consul:8500", address)
+		require.Equal(t, consulDefaultKey, key)
+	})
+
+	t.Run("unsupported scheme returns an error", func(t *testing.T) {
+		_, _, err := parseConsulDSN("etcd://consul:8500/mattermost/config")
+		require.Error(t, err)
+	})
+
+	t.Run("malformed DSN returns an error", func(t *testing.T) {
+		_, _, err := parseConsulDSN("consul://\x7f")
+		require.Error(t, err)
+	})
+}
@@ -5,12 +5,16 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost-server/mlog"
@@ -18,8 +22,6 @@ import (
 
 	// Load the MySQL driver
 	_ "github.com/go-sql-driver/mysql"
-	// Load the Postgres driver
-	_ "github.com/lib/pq"
 )
 
 // DatabaseStore is a config store backed by a database.
@@ -30,10 +32,42 @@ type DatabaseStore struct {
 	driverName     string
 	dataSourceName string
 	db             *sqlx.DB
+
+	watchInterval time.Duration
+	watchMutex    sync.Mutex
+	watchCancel   context.CancelFunc
+
+	lastWrittenIdMutex sync.Mutex
+	lastWrittenId      string // guarded by lastWrittenIdMutex; written by persist, read by watch to ignore self-originated changes
+
+	cipher Cipher
+}
+
+func (ds *DatabaseStore) getLastWrittenId() string {
+	ds.lastWrittenIdMutex.Lock()
+	defer ds.lastWrittenIdMutex.Unlock()
+
+	return ds.lastWrittenId
+}
+
+func (ds *DatabaseStore) setLastWrittenId(id string) {
+	ds.lastWrittenIdMutex.Lock()
+	defer ds.lastWrittenIdMutex.Unlock()
+
+	ds.lastWrittenId = id
+}
+
+// WithCipher configures the Cipher used to encrypt the configuration at rest. If not
+// supplied, NewDatabaseStore falls back to an AES-256-GCM cipher seeded from
+// MM_CONFIG_ENCRYPTION_KEY, leaving the configuration unencrypted if that is unset too.
+func WithCipher(cipher Cipher) DatabaseStoreOption {
+	return func(ds *DatabaseStore) {
+		ds.cipher = cipher
+	}
 }
 
 // NewDatabaseStore creates a new instance of a config store backed by the given database.
-func NewDatabaseStore(dsn string) (ds *DatabaseStore, err error) {
+func NewDatabaseStore(dsn string, options ...DatabaseStoreOption) (ds *DatabaseStore, err error) {
 	driverName, dataSourceName, err := parseDSN(dsn)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid DSN")
@@ -50,6 +84,17 @@ func NewDatabaseStore(dsn string) (ds *DatabaseStore, err error) {
 		dataSourceName: dataSourceName,
 		db:             db,
 	}
+
+	for _, option := range options {
+		option(ds)
+	}
+
+	if ds.cipher == nil {
+		if ds.cipher, err = NewAESCipherFromEnv(); err != nil {
+			return nil, errors.Wrap(err, "failed to initialize config encryption")
+		}
+	}
+
 	if err = initializeConfigurationsTable(ds.db); err != nil {
 		return nil, errors.Wrap(err, "failed to initialize")
 	}
@@ -58,6 +103,10 @@ func NewDatabaseStore(dsn string) (ds *DatabaseStore, err error) {
 		return nil, errors.Wrap(err, "failed to load")
 	}
 
+	if err = ds.Watch(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "failed to start watching for configuration changes")
+	}
+
 	return ds, nil
 }
 
@@ -123,6 +172,12 @@ func (ds *DatabaseStore) persist(cfg *model.Config) error {
 		return errors.Wrap(err, "failed to serialize")
 	}
 
+	if ds.cipher != nil {
+		if b, err = ds.cipher.Encrypt(b); err != nil {
+			return errors.Wrap(err, "failed to encrypt configuration")
+		}
+	}
+
 	id := model.NewId()
 	value := string(b)
 	createAt := model.GetMillis()
@@ -153,6 +208,17 @@ func (ds *DatabaseStore) persist(cfg *model.Config) error {
 		return errors.Wrap(err, "failed to record new configuration")
 	}
 
+	if ds.driverName == "postgres" {
+		if _, err := tx.Exec("NOTIFY " + configChangedChannel + ", " + pq.QuoteLiteral(id)); err != nil {
+			return errors.Wrap(err, "failed to notify cluster of configuration change")
+		}
+	}
+
+	// Record this node as the origin of id so the watcher started by Watch can recognize its
+	// own write and avoid reloading and re-dispatching listeners a second time. This happens
+	// before Commit, as the NOTIFY and the new active row become visible to the watcher then.
+	ds.setLastWrittenId(id)
+
 	if err := tx.Commit(); err != nil {
 		return errors.Wrap(err, "failed to commit transaction")
 	}
@@ -170,6 +236,18 @@ func (ds *DatabaseStore) Load() (err error) {
 		return errors.Wrap(err, "failed to query active configuration")
 	}
 
+	// Rows that begin with envelopeMagic are envelopes produced by a Cipher and must be
+	// decrypted before use; anything else is treated as legacy plaintext JSON.
+	if len(configurationData) > 0 && isEncryptedValue(configurationData) {
+		if ds.cipher == nil {
+			return errors.New("configuration is encrypted, but no cipher is configured")
+		}
+
+		if configurationData, err = ds.cipher.Decrypt(configurationData); err != nil {
+			return errors.Wrap(err, "failed to decrypt configuration")
+		}
+	}
+
 	// Initialize from the default config if no active configuration could be found.
 	if len(configurationData) == 0 {
 		needsSave = true
@@ -212,8 +290,54 @@ func (ds *DatabaseStore) String() string {
 
 // Close cleans up resources associated with the store.
 func (ds *DatabaseStore) Close() error {
+	ds.StopWatching()
+
 	ds.configLock.Lock()
 	defer ds.configLock.Unlock()
 
 	return ds.db.Close()
 }
+
+// Rekey re-encrypts the active configuration row under the given key id, rotating it out from
+// whatever key previously protected it. It requires a Cipher that supports encrypting under an
+// explicit key id, such as the one returned by NewEnvelopeCipher.
+func (ds *DatabaseStore) Rekey(newKid string) error {
+	rotator, ok := ds.cipher.(keyRotator)
+	if !ok {
+		return errors.New("configured cipher does not support rekeying")
+	}
+
+	ds.configLock.RLock()
+	cfg := ds.config
+	ds.configLock.RUnlock()
+
+	b, err := marshalConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize")
+	}
+
+	value, err := rotator.encryptWithKeyId(b, newKid)
+	if err != nil {
+		return errors.Wrap(err, "failed to re-encrypt configuration")
+	}
+
+	tx, err := ds.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			mlog.Error("Failed to rollback rekey transaction", mlog.Err(err))
+		}
+	}()
+
+	if _, err := tx.NamedExec("UPDATE Configurations SET Value = :value WHERE Active", map[string]interface{}{"value": string(value)}); err != nil {
+		return errors.Wrap(err, "failed to rekey active configuration")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
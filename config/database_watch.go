@@ -0,0 +1,154 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-server/mlog"
+)
+
+const (
+	configChangedChannel   = "mattermost_config_changed"
+	defaultWatchInterval   = 15 * time.Second
+	pqListenerMinReconnect = 10 * time.Second
+	pqListenerMaxReconnect = time.Minute
+)
+
+// DatabaseStoreOption modifies the behavior of a DatabaseStore at construction time.
+type DatabaseStoreOption func(*DatabaseStore)
+
+// WithWatchInterval configures the interval at which a MySQL-backed DatabaseStore polls for
+// configuration changes made by other nodes in the cluster. It has no effect on Postgres,
+// which instead relies on LISTEN/NOTIFY.
+func WithWatchInterval(interval time.Duration) DatabaseStoreOption {
+	return func(ds *DatabaseStore) {
+		ds.watchInterval = interval
+	}
+}
+
+// Watch starts a background goroutine that observes configuration changes made by other app
+// servers sharing this database and reloads the local configuration when one is detected.
+// On Postgres, this uses LISTEN/NOTIFY; on MySQL, it polls at the configured interval.
+func (ds *DatabaseStore) Watch(ctx context.Context) error {
+	ds.watchMutex.Lock()
+	defer ds.watchMutex.Unlock()
+
+	if ds.watchCancel != nil {
+		return errors.New("already watching for configuration changes")
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	ds.watchCancel = cancel
+
+	switch ds.driverName {
+	case "postgres":
+		go ds.watchPostgres(watchCtx)
+	case "mysql":
+		go ds.watchMySQL(watchCtx)
+	default:
+		cancel()
+		ds.watchCancel = nil
+		return errors.Errorf("watching is not supported for driver %s", ds.driverName)
+	}
+
+	return nil
+}
+
+// StopWatching cancels any in-progress watch started by Watch.
+func (ds *DatabaseStore) StopWatching() {
+	ds.watchMutex.Lock()
+	defer ds.watchMutex.Unlock()
+
+	if ds.watchCancel != nil {
+		ds.watchCancel()
+		ds.watchCancel = nil
+	}
+}
+
+func (ds *DatabaseStore) watchPostgres(ctx context.Context) {
+	listener := pq.NewListener(ds.dataSourceName, pqListenerMinReconnect, pqListenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			mlog.Error("Configuration listener event", mlog.Err(err))
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(configChangedChannel); err != nil {
+		mlog.Error("Failed to listen for configuration changes", mlog.Err(err))
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			// The NOTIFY payload is the id of the newly-activated configuration, set by
+			// persist(). If it matches the id this node just wrote itself, skip the reload:
+			// this node already has the change applied and its listeners already notified.
+			if notification != nil && notification.Extra != "" && notification.Extra == ds.getLastWrittenId() {
+				continue
+			}
+
+			if err := ds.Load(); err != nil {
+				mlog.Error("Failed to reload configuration after cluster notification", mlog.Err(err))
+			}
+		case <-time.After(90 * time.Second):
+			// Ping the connection to detect silently dropped listeners.
+			go listener.Ping()
+		}
+	}
+}
+
+func (ds *DatabaseStore) watchMySQL(ctx context.Context) {
+	interval := ds.watchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastId := ds.activeId()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			id := ds.activeId()
+			if id == "" || id == lastId {
+				continue
+			}
+			lastId = id
+
+			// Skip the reload if this node is the one that wrote id: it already has the
+			// change applied and its listeners already notified.
+			if id == ds.getLastWrittenId() {
+				continue
+			}
+
+			if err := ds.Load(); err != nil {
+				mlog.Error("Failed to reload configuration after detecting remote change", mlog.Err(err))
+			}
+		}
+	}
+}
+
+// activeId returns the id of the currently active configuration row, if any.
+func (ds *DatabaseStore) activeId() string {
+	var id string
+	row := ds.db.QueryRow("SELECT Id FROM Configurations WHERE Active")
+	if err := row.Scan(&id); err != nil && err != sql.ErrNoRows {
+		mlog.Error("Failed to query active configuration id", mlog.Err(err))
+	}
+
+	return id
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	configEncryptionKeyEnvVar = "MM_CONFIG_ENCRYPTION_KEY"
+
+	// envelopeMagic prefixes an encrypted Value so that Load can distinguish it from a legacy
+	// plaintext row, which always begins with the '{' of its serialized JSON.
+	envelopeMagic   = "MMENV1:"
+	envelopeVersion = 1
+
+	// staticKeyId identifies the single key used by an AES cipher seeded directly from
+	// MM_CONFIG_ENCRYPTION_KEY, as opposed to one fetched from a KeyProvider.
+	staticKeyId = "static"
+)
+
+// Cipher encrypts and decrypts the serialized configuration stored in the Value column. An
+// implementation is free to choose its own on-disk envelope format, so long as Encrypt and
+// Decrypt round-trip with each other.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// envelope is the versioned, on-disk representation of an encrypted configuration.
+type envelope struct {
+	V     int    `json:"v"`
+	Kid   string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	CT    []byte `json:"ct"`
+}
+
+// isEncryptedValue reports whether the raw Value column holds an envelope produced by a
+// Cipher, as opposed to legacy plaintext JSON.
+func isEncryptedValue(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(envelopeMagic))
+}
+
+func sealEnvelope(gcm cipher.AEAD, kid string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+
+	ct := gcm.Seal(nil, nonce, plaintext, nil)
+
+	b, err := json.Marshal(envelope{V: envelopeVersion, Kid: kid, Nonce: nonce, CT: ct})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal envelope")
+	}
+
+	return append([]byte(envelopeMagic), b...), nil
+}
+
+func openEnvelope(data []byte) (envelope, error) {
+	var env envelope
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte(envelopeMagic)), &env); err != nil {
+		return envelope{}, errors.Wrap(err, "failed to unmarshal envelope")
+	}
+
+	if env.V != envelopeVersion {
+		return envelope{}, errors.Errorf("unsupported envelope version %d", env.V)
+	}
+
+	return env, nil
+}
+
+// aesCipher is a Cipher backed by a single AES-256-GCM key.
+type aesCipher struct {
+	key []byte
+}
+
+// NewAESCipher constructs a Cipher from a raw 32-byte AES-256 key.
+func NewAESCipher(key []byte) (Cipher, error) {
+	if len(key) != 32 {
+		return nil, errors.New("AES-256 key must be 32 bytes")
+	}
+
+	return &aesCipher{key: key}, nil
+}
+
+// NewAESCipherFromEnv constructs a Cipher from the base64-encoded 32-byte key in
+// MM_CONFIG_ENCRYPTION_KEY. It returns nil, nil if the environment variable is unset, leaving
+// the configuration unencrypted.
+func NewAESCipherFromEnv() (Cipher, error) {
+	encoded := os.Getenv(configEncryptionKeyEnvVar)
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", configEncryptionKeyEnvVar)
+	}
+
+	return NewAESCipher(key)
+}
+
+func (c *aesCipher) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize AES cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (c *aesCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	return sealEnvelope(gcm, staticKeyId, plaintext)
+}
+
+func (c *aesCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	env, err := openEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, env.Nonce, env.CT, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt configuration")
+	}
+
+	return plaintext, nil
+}
+
+// KeyProvider resolves the key encryption keys (KEKs) used by an envelopeCipher, typically
+// backed by an external KMS.
+type KeyProvider interface {
+	// GetKey returns the key material for the given key id.
+	GetKey(kid string) ([]byte, error)
+
+	// ActiveKeyId returns the id of the key that should be used to encrypt new data.
+	ActiveKeyId() string
+}
+
+// envelopeCipher is a Cipher that fetches its key encryption key from a KeyProvider for each
+// operation, allowing the active key to change (e.g. during a Rekey) without restarting.
+type envelopeCipher struct {
+	provider KeyProvider
+}
+
+// NewEnvelopeCipher constructs a Cipher that delegates key material to the given KeyProvider.
+func NewEnvelopeCipher(provider KeyProvider) Cipher {
+	return &envelopeCipher{provider: provider}
+}
+
+func (c *envelopeCipher) gcmFor(kid string) (cipher.AEAD, error) {
+	key, err := c.provider.GetKey(kid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch key %s", kid)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize AES cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (c *envelopeCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return c.encryptWithKeyId(plaintext, c.provider.ActiveKeyId())
+}
+
+func (c *envelopeCipher) encryptWithKeyId(plaintext []byte, kid string) ([]byte, error) {
+	gcm, err := c.gcmFor(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealEnvelope(gcm, kid, plaintext)
+}
+
+func (c *envelopeCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	env, err := openEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := c.gcmFor(env.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, env.Nonce, env.CT, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt configuration")
+	}
+
+	return plaintext, nil
+}
+
+// keyRotator is implemented by ciphers that support encrypting under an explicitly chosen key
+// id, which Rekey relies on.
+type keyRotator interface {
+	encryptWithKeyId(plaintext []byte, kid string) ([]byte, error)
+}
+
+// fileKeyProvider is a reference KeyProvider backed by a local JSON file of the form:
+//
+//	{
+//	  "active": "2024-01",
+//	  "keys": {"2024-01": "<base64 key>"}
+//	}
+//
+// Production deployments are expected to supply a KeyProvider backed by their KMS of choice.
+type fileKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+type fileKeyProviderDocument struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider loads key material from a local JSON file.
+func NewFileKeyProvider(path string) (KeyProvider, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key file")
+	}
+
+	var doc fileKeyProviderDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse key file")
+	}
+
+	if doc.Active == "" {
+		return nil, errors.New("key file does not specify an active key id")
+	}
+
+	keys := make(map[string][]byte, len(doc.Keys))
+	for kid, encoded := range doc.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode key %s", kid)
+		}
+		keys[kid] = key
+	}
+
+	if _, ok := keys[doc.Active]; !ok {
+		return nil, errors.Errorf("active key id %s not present in key file", doc.Active)
+	}
+
+	return &fileKeyProvider{active: doc.Active, keys: keys}, nil
+}
+
+func (p *fileKeyProvider) GetKey(kid string) ([]byte, error) {
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key id %s", kid)
+	}
+
+	return key, nil
+}
+
+func (p *fileKeyProvider) ActiveKeyId() string {
+	return p.active
+}
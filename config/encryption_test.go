@@ -0,0 +1,97 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestAESCipherRoundTrip(t *testing.T) {
+	c, err := NewAESCipher(randomKey(t))
+	require.NoError(t, err)
+
+	plaintext := []byte(`{"SqlSettings":{}}`)
+
+	ciphertext, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.True(t, isEncryptedValue(ciphertext))
+
+	decrypted, err := c.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+}
+
+func TestAESCipherRejectsWrongKeySize(t *testing.T) {
+	_, err := NewAESCipher([]byte("too-short"))
+	require.Error(t, err)
+}
+
+func TestIsEncryptedValueDistinguishesLegacyPlaintext(t *testing.T) {
+	require.False(t, isEncryptedValue([]byte(`{"SqlSettings":{}}`)))
+	require.True(t, isEncryptedValue([]byte(envelopeMagic+`{"v":1}`)))
+}
+
+type staticKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+func (p *staticKeyProvider) GetKey(kid string) ([]byte, error) {
+	return p.keys[kid], nil
+}
+
+func (p *staticKeyProvider) ActiveKeyId() string {
+	return p.active
+}
+
+func TestEnvelopeCipherRoundTrip(t *testing.T) {
+	provider := &staticKeyProvider{
+		active: "2024-01",
+		keys:   map[string][]byte{"2024-01": randomKey(t)},
+	}
+	c := NewEnvelopeCipher(provider)
+
+	plaintext := []byte(`{"SqlSettings":{}}`)
+
+	ciphertext, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	decrypted, err := c.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+}
+
+func TestEnvelopeCipherRekeySupportsEncryptingUnderAnotherKey(t *testing.T) {
+	provider := &staticKeyProvider{
+		active: "2024-01",
+		keys: map[string][]byte{
+			"2024-01": randomKey(t),
+			"2024-02": randomKey(t),
+		},
+	}
+	c := NewEnvelopeCipher(provider).(keyRotator)
+
+	plaintext := []byte(`{"SqlSettings":{}}`)
+
+	ciphertext, err := c.encryptWithKeyId(plaintext, "2024-02")
+	require.NoError(t, err)
+
+	env, err := openEnvelope(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "2024-02", env.Kid)
+
+	decrypted, err := c.(Cipher).Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+}
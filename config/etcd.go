@@ -0,0 +1,215 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+const etcdDefaultKey = "mattermost/config"
+
+// EtcdStore is a config store backed by an etcd key, suitable for Kubernetes deployments that
+// already run etcd and would rather not provision a database purely for early-boot config.
+type EtcdStore struct {
+	commonStore
+
+	originalDsn string
+	key         string
+	client      *clientv3.Client
+
+	revisionMutex sync.Mutex
+	revision      int64 // guarded by revisionMutex; written by persist/Load, read by watch
+
+	watchMutex  sync.Mutex
+	watchCancel context.CancelFunc
+}
+
+func (es *EtcdStore) getRevision() int64 {
+	es.revisionMutex.Lock()
+	defer es.revisionMutex.Unlock()
+
+	return es.revision
+}
+
+func (es *EtcdStore) setRevision(revision int64) {
+	es.revisionMutex.Lock()
+	defer es.revisionMutex.Unlock()
+
+	es.revision = revision
+}
+
+// NewEtcdStore creates a new instance of a config store backed by etcd.
+//
+// The DSN is of the form etcd://host:port,host:port/path/to/key.
+func NewEtcdStore(dsn string) (es *EtcdStore, err error) {
+	endpoints, key, err := parseEtcdDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DSN")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to etcd")
+	}
+
+	es = &EtcdStore{
+		originalDsn: dsn,
+		key:         key,
+		client:      client,
+	}
+
+	if err = es.Load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load")
+	}
+
+	go es.watch()
+
+	return es, nil
+}
+
+// parseEtcdDSN splits an etcd DSN into its endpoints and key.
+//
+// For example:
+//	etcd://etcd-0:2379,etcd-1:2379/mattermost/config
+// returns
+//	endpoints = []string{"etcd-0:2379", "etcd-1:2379"}
+//	key = "mattermost/config"
+func parseEtcdDSN(dsn string) ([]string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to parse DSN as URL")
+	}
+
+	if u.Scheme != "etcd" {
+		return nil, "", errors.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	endpoints := strings.Split(u.Host, ",")
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		key = etcdDefaultKey
+	}
+
+	return endpoints, key, nil
+}
+
+// Set replaces the current configuration in its entirety, without updating the backing store.
+func (es *EtcdStore) Set(newCfg *model.Config) (*model.Config, error) {
+	return es.commonStore.set(newCfg, nil)
+}
+
+// persist writes the configuration under the configured etcd key.
+func (es *EtcdStore) persist(cfg *model.Config) error {
+	b, err := marshalConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize")
+	}
+
+	resp, err := es.client.Put(context.Background(), es.key, string(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to write configuration to etcd")
+	}
+
+	es.setRevision(resp.Header.Revision)
+
+	return nil
+}
+
+// Load updates the current configuration from etcd.
+func (es *EtcdStore) Load() (err error) {
+	var needsSave bool
+	var configurationData []byte
+
+	resp, err := es.client.Get(context.Background(), es.key)
+	if err != nil {
+		return errors.Wrap(err, "failed to read configuration from etcd")
+	}
+
+	if len(resp.Kvs) == 0 {
+		needsSave = true
+
+		defaultCfg := model.Config{}
+		defaultCfg.SetDefaults()
+
+		configurationData, err = marshalConfig(&defaultCfg)
+		if err != nil {
+			return errors.Wrap(err, "failed to serialize default config")
+		}
+	} else {
+		configurationData = resp.Kvs[0].Value
+		es.setRevision(resp.Kvs[0].ModRevision)
+	}
+
+	return es.commonStore.load(ioutil.NopCloser(bytes.NewReader(configurationData)), needsSave, es.persist)
+}
+
+// Save writes the current configuration to etcd.
+func (es *EtcdStore) Save() error {
+	es.configLock.RLock()
+	defer es.configLock.RUnlock()
+
+	return es.persist(es.config)
+}
+
+// String returns the DSN of the etcd store, masking any embedded credentials.
+func (es *EtcdStore) String() string {
+	u, _ := url.Parse(es.originalDsn)
+
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+
+	return u.String()
+}
+
+// Close cleans up resources associated with the store.
+func (es *EtcdStore) Close() error {
+	es.watchMutex.Lock()
+	if es.watchCancel != nil {
+		es.watchCancel()
+		es.watchCancel = nil
+	}
+	es.watchMutex.Unlock()
+
+	return es.client.Close()
+}
+
+// watch uses etcd's native watch support to reload the configuration whenever another node
+// updates it, driving invokeConfigListeners via Load.
+func (es *EtcdStore) watch() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	es.watchMutex.Lock()
+	es.watchCancel = cancel
+	es.watchMutex.Unlock()
+
+	rch := es.client.Watch(ctx, es.key, clientv3.WithRev(es.getRevision()+1))
+	for resp := range rch {
+		for _, ev := range resp.Events {
+			if ev.Kv.ModRevision <= es.getRevision() {
+				continue
+			}
+
+			if err := es.Load(); err != nil {
+				mlog.Error("Failed to reload configuration after etcd watch event", mlog.Err(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEtcdDSN(t *testing.T) {
+	t.Run("single endpoint with explicit key", func(t *testing.T) {
+		endpoints, key, err := parseEtcdDSN("etcd://etcd-0:2379/mattermost/config")
+		require.NoError(t, err)
+		require.Equal(t, []string{"etcd-0:2379"}, endpoints)
+		require.Equal(t, "mattermost/config", key)
+	})
+
+	t.Run("multiple endpoints", func(t *testing.T) {
+		endpoints, key, err := parseEtcdDSN("etcd://etcd-0:2379,etcd-1:2379/mattermost/config")
+		require.NoError(t, err)
+		require.Equal(t, []string{"etcd-0:2379", "etcd-1:2379"}, endpoints)
+		require.Equal(t, "mattermost/config", key)
+	})
+
+	t.Run("missing key falls back to the default", func(t *testing.T) {
+		endpoints, key, err := parseEtcdDSN("etcd://etcd-0:2379")
+		require.NoError(t, err)
+		require.Equal(t, []string{"etcd-0:2379"}, endpoints)
+		require.Equal(t, etcdDefaultKey, key)
+	})
+
+	t.Run("unsupported scheme returns an error", func(t *testing.T) {
+		_, _, err := parseEtcdDSN("consul://etcd-0:2379/mattermost/config")
+		require.Error(t, err)
+	})
+
+	t.Run("malformed DSN returns an error", func(t *testing.T) {
+		_, _, err := parseEtcdDSN("etcd://\x7f")
+		require.Error(t, err)
+	})
+}
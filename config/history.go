@@ -0,0 +1,221 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// ConfigRevision describes a single persisted revision of the configuration.
+type ConfigRevision struct {
+	Id       string `db:"Id"`
+	CreateAt int64  `db:"CreateAt"`
+	Active   bool   `db:"Active"`
+}
+
+// ConfigChange describes a single field that differs between two configurations.
+type ConfigChange struct {
+	Path     string      `json:"path"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// sensitiveFieldNames mirrors the heuristic used elsewhere when masking secrets for display.
+var sensitiveFieldNames = []string{"password", "secret", "salt", "token", "key"}
+
+const maskedValue = "********"
+
+// List returns the available configuration revisions, most recent first.
+func (ds *DatabaseStore) List(offset, limit int) ([]ConfigRevision, error) {
+	query, args, err := sqlx.Named(
+		// Inactive rows hold NULL in Active, which cannot be scanned into a bool.
+		"SELECT Id, CreateAt, COALESCE(Active, FALSE) AS Active FROM Configurations ORDER BY CreateAt DESC LIMIT :limit OFFSET :offset",
+		map[string]interface{}{"limit": limit, "offset": offset},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build configuration revisions query")
+	}
+
+	var revisions []ConfigRevision
+	if err := ds.db.Select(&revisions, ds.db.Rebind(query), args...); err != nil {
+		return nil, errors.Wrap(err, "failed to query configuration revisions")
+	}
+
+	return revisions, nil
+}
+
+// GetRevision fetches the configuration as persisted for the given revision id.
+func (ds *DatabaseStore) GetRevision(id string) (*model.Config, error) {
+	var configurationData []byte
+
+	row := ds.db.QueryRow(ds.db.Rebind("SELECT Value FROM Configurations WHERE Id = ?"), id)
+	if err := row.Scan(&configurationData); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Errorf("no configuration revision found for id %s", id)
+		}
+		return nil, errors.Wrap(err, "failed to query configuration revision")
+	}
+
+	if isEncryptedValue(configurationData) {
+		if ds.cipher == nil {
+			return nil, errors.New("configuration revision is encrypted, but no cipher is configured")
+		}
+
+		var err error
+		if configurationData, err = ds.cipher.Decrypt(configurationData); err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt configuration revision")
+		}
+	}
+
+	cfg, _, err := unmarshalConfig(ioutil.NopCloser(bytes.NewReader(configurationData)), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal configuration revision")
+	}
+
+	return cfg, nil
+}
+
+// Diff reports the fields that differ between the two given configuration revisions,
+// redacting sensitive values in the same manner as desanitize.
+func (ds *DatabaseStore) Diff(idA, idB string) ([]ConfigChange, error) {
+	cfgA, err := ds.GetRevision(idA)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load revision %s", idA)
+	}
+
+	cfgB, err := ds.GetRevision(idB)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load revision %s", idB)
+	}
+
+	return diffConfigs(cfgA, cfgB), nil
+}
+
+// Activate promotes the given revision to be the active configuration, going through the
+// same validation and listener notification path as Set so that subscribers are notified
+// of the rollback.
+func (ds *DatabaseStore) Activate(id string) (*model.Config, error) {
+	cfg, err := ds.GetRevision(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load revision %s", id)
+	}
+
+	oldCfg, err := ds.commonStore.set(cfg, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to activate revision")
+	}
+
+	newCfg := ds.Get()
+
+	if err := ds.persist(newCfg); err != nil {
+		// The in-memory configuration already moved to newCfg and listeners have already
+		// observed it, but the database was never updated. Restore the prior configuration,
+		// same as the rollback commonStore.set performs when a critical listener fails, so the
+		// two don't stay inconsistent until some later Save or Load. As there, only roll back
+		// if newCfg is still current, to avoid clobbering a concurrent update.
+		ds.configLock.Lock()
+		if ds.config == newCfg {
+			ds.config = oldCfg
+		}
+		ds.configLock.Unlock()
+
+		return nil, errors.Wrap(err, "failed to persist activated revision")
+	}
+
+	return oldCfg, nil
+}
+
+// diffConfigs walks the two configurations reflectively, reporting the dot-path of every
+// field whose value differs. Sensitive fields are redacted rather than disclosed.
+func diffConfigs(a, b *model.Config) []ConfigChange {
+	var changes []ConfigChange
+	walkDiff(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", &changes)
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes
+}
+
+func walkDiff(a, b reflect.Value, path string, changes *[]ConfigChange) {
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				recordChange(path, a, b, changes)
+			}
+			return
+		}
+		walkDiff(a.Elem(), b.Elem(), path, changes)
+		return
+	}
+
+	if a.Kind() == reflect.Struct {
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.PkgPath != "" {
+				// unexported
+				continue
+			}
+
+			fieldPath := field.Name
+			if path != "" {
+				fieldPath = path + "." + field.Name
+			}
+
+			walkDiff(a.Field(i), b.Field(i), fieldPath, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		recordChange(path, a, b, changes)
+	}
+}
+
+func recordChange(path string, a, b reflect.Value, changes *[]ConfigChange) {
+	oldValue, newValue := interfaceOf(a), interfaceOf(b)
+
+	if isSensitivePath(path) {
+		oldValue, newValue = maskedValue, maskedValue
+	}
+
+	*changes = append(*changes, ConfigChange{
+		Path:     path,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		return v.Elem().Interface()
+	}
+
+	return v.Interface()
+}
+
+// isSensitivePath reports whether the given dot-path looks like a secret, using the same
+// naming heuristic that desanitize relies on elsewhere.
+func isSensitivePath(path string) bool {
+	lower := strings.ToLower(path)
+	for _, name := range sensitiveFieldNames {
+		if strings.Contains(lower, name) {
+			return true
+		}
+	}
+
+	return false
+}
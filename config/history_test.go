@@ -0,0 +1,60 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	t.Run("no changes", func(t *testing.T) {
+		cfgA := &model.Config{}
+		cfgA.SetDefaults()
+		cfgB := cfgA.Clone()
+
+		require.Empty(t, diffConfigs(cfgA, cfgB))
+	})
+
+	t.Run("changed field is reported with its dot-path", func(t *testing.T) {
+		cfgA := &model.Config{}
+		cfgA.SetDefaults()
+		cfgB := cfgA.Clone()
+		cfgB.SqlSettings.DriverName = model.NewString(model.DATABASE_DRIVER_POSTGRES)
+
+		changes := diffConfigs(cfgA, cfgB)
+		require.Len(t, changes, 1)
+		require.Equal(t, "SqlSettings.DriverName", changes[0].Path)
+		require.Equal(t, *cfgA.SqlSettings.DriverName, changes[0].OldValue)
+		require.Equal(t, model.DATABASE_DRIVER_POSTGRES, changes[0].NewValue)
+	})
+
+	t.Run("sensitive fields are redacted", func(t *testing.T) {
+		cfgA := &model.Config{}
+		cfgA.SetDefaults()
+		cfgB := cfgA.Clone()
+		cfgB.SqlSettings.AtRestEncryptKey = model.NewString("a-different-secret")
+
+		changes := diffConfigs(cfgA, cfgB)
+		require.Len(t, changes, 1)
+		require.Equal(t, "SqlSettings.AtRestEncryptKey", changes[0].Path)
+		require.Equal(t, maskedValue, changes[0].OldValue)
+		require.Equal(t, maskedValue, changes[0].NewValue)
+	})
+}
+
+func TestIsSensitivePath(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"SqlSettings.AtRestEncryptKey": true,
+		"FileSettings.PublicLinkSalt":  true,
+		"EmailSettings.InviteSalt":     true,
+		"EmailSettings.SMTPPassword":   true,
+		"SqlSettings.DriverName":       false,
+		"ServiceSettings.SiteURL":      false,
+	} {
+		require.Equal(t, expected, isSensitivePath(path), path)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// Listener is a callback function invoked with the old and new configuration after a change.
+type Listener func(oldCfg, newCfg *model.Config)
+
+const defaultListenerTimeout = 30 * time.Second
+
+// ListenerOptions customizes how a registered Listener participates in a dispatch.
+type ListenerOptions struct {
+	// Timeout bounds how long the listener is given to run before it is considered to have
+	// failed. Defaults to 30 seconds if zero.
+	Timeout time.Duration
+
+	// Synchronous causes invokeConfigListeners to wait for this listener to finish (subject to
+	// Timeout) before returning control to the caller of Set/Load. Listeners registered
+	// without this are dispatched in the background instead.
+	Synchronous bool
+
+	// Critical implies Synchronous, and additionally causes invokeConfigListeners to return an
+	// error - rolling back the configuration change - if this listener fails or times out.
+	Critical bool
+}
+
+// ListenerDiagnostics reports the outcome of the most recent dispatch to a single listener.
+type ListenerDiagnostics struct {
+	Duration   time.Duration
+	Err        error
+	PanicStack string
+}
+
+type registeredListener struct {
+	fn      Listener
+	options ListenerOptions
+}
+
+// emitter enables code sharing between different backing implementations wishing to notify
+// registered listeners of configuration changes. Listeners are dispatched each in their own
+// goroutine, isolated from one another by a per-listener timeout and panic recovery. Dispatches
+// across calls to invokeConfigListeners are serialized so that listeners always observe
+// monotonic (oldCfg, newCfg) transitions.
+type emitter struct {
+	listenerLock sync.Mutex
+	listeners    map[string]*registeredListener
+
+	dispatchLock sync.Mutex
+
+	diagnosticsLock sync.Mutex
+	diagnostics     map[string]ListenerDiagnostics
+}
+
+// AddListener adds a callback function to invoke when the configuration changes, returning a
+// unique id that can later be passed to RemoveListener. The listener is dispatched
+// asynchronously with the default timeout; use AddListenerWithOptions for more control.
+func (e *emitter) AddListener(listener Listener) string {
+	id := model.NewId()
+	e.AddListenerWithOptions(id, listener, ListenerOptions{})
+
+	return id
+}
+
+// AddListenerWithOptions adds a callback function under the given id, customizing how it is
+// dispatched via opts. Registering under an id already in use replaces that listener.
+func (e *emitter) AddListenerWithOptions(id string, listener Listener, opts ListenerOptions) {
+	e.listenerLock.Lock()
+	defer e.listenerLock.Unlock()
+
+	if e.listeners == nil {
+		e.listeners = make(map[string]*registeredListener)
+	}
+
+	e.listeners[id] = &registeredListener{fn: listener, options: opts}
+}
+
+// RemoveListener removes a callback function using an id returned from AddListener.
+func (e *emitter) RemoveListener(id string) {
+	e.listenerLock.Lock()
+	defer e.listenerLock.Unlock()
+
+	delete(e.listeners, id)
+}
+
+// ListenerDiagnostics reports the last-run duration, error, and panic stack (if any) observed
+// for each listener that has been dispatched to at least once.
+func (e *emitter) ListenerDiagnostics() map[string]ListenerDiagnostics {
+	e.diagnosticsLock.Lock()
+	defer e.diagnosticsLock.Unlock()
+
+	diagnostics := make(map[string]ListenerDiagnostics, len(e.diagnostics))
+	for id, diagnostic := range e.diagnostics {
+		diagnostics[id] = diagnostic
+	}
+
+	return diagnostics
+}
+
+// invokeConfigListeners dispatches oldCfg/newCfg to every registered listener, each in its own
+// goroutine, recovering any panic so that one broken listener cannot affect another. Listeners
+// registered as Synchronous or Critical are waited on before this function returns; the rest
+// are dispatched in the background. Regardless, every listener in the fan-out - including
+// backgrounded ones - is allowed to complete or time out before the next call to
+// invokeConfigListeners begins, so listeners see config changes in order. A listener that times
+// out keeps running in its goroutine and may overlap the next dispatch. If a Critical listener
+// failed or timed out, invokeConfigListeners returns an error so the caller can roll back the
+// configuration change.
+func (e *emitter) invokeConfigListeners(oldCfg, newCfg *model.Config) error {
+	e.dispatchLock.Lock()
+
+	e.listenerLock.Lock()
+	listeners := make(map[string]*registeredListener, len(e.listeners))
+	for id, listener := range e.listeners {
+		listeners[id] = listener
+	}
+	e.listenerLock.Unlock()
+
+	var fanOut sync.WaitGroup
+	var blocking sync.WaitGroup
+	fanOut.Add(len(listeners))
+
+	go func() {
+		fanOut.Wait()
+		e.dispatchLock.Unlock()
+	}()
+
+	for id, listener := range listeners {
+		id, listener := id, listener
+
+		mustWait := listener.options.Synchronous || listener.options.Critical
+		if mustWait {
+			blocking.Add(1)
+		}
+
+		go func() {
+			defer fanOut.Done()
+			if mustWait {
+				defer blocking.Done()
+			}
+
+			e.dispatchOne(id, listener, oldCfg, newCfg)
+		}()
+	}
+
+	blocking.Wait()
+
+	var criticalErr error
+	for id, listener := range listeners {
+		if !listener.options.Critical {
+			continue
+		}
+
+		if diagnostic, ok := e.diagnosticFor(id); ok && (diagnostic.Err != nil || diagnostic.PanicStack != "") {
+			criticalErr = errors.Wrapf(diagnosticError(diagnostic), "critical configuration listener %s failed", id)
+			break
+		}
+	}
+
+	return criticalErr
+}
+
+// dispatchOne invokes a single listener with its configured timeout. The listener goroutine
+// itself publishes the resulting diagnostic once it completes, so that a timed-out-but-still-
+// running listener cannot race with this function over a shared variable; if it later finishes,
+// its diagnostic simply overwrites the timeout one recorded here.
+func (e *emitter) dispatchOne(id string, listener *registeredListener, oldCfg, newCfg *model.Config) {
+	timeout := listener.options.Timeout
+	if timeout <= 0 {
+		timeout = defaultListenerTimeout
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		var panicStack string
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					panicStack = fmt.Sprintf("%v\n%s", r, debug.Stack())
+				}
+			}()
+
+			listener.fn(oldCfg, newCfg)
+		}()
+
+		e.recordDiagnostic(id, ListenerDiagnostics{
+			Duration:   time.Since(start),
+			PanicStack: panicStack,
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		e.recordDiagnostic(id, ListenerDiagnostics{
+			Duration: time.Since(start),
+			Err:      errors.Errorf("listener %s did not complete within %s", id, timeout),
+		})
+	}
+}
+
+// recordDiagnostic stores the outcome of a single listener dispatch.
+func (e *emitter) recordDiagnostic(id string, diagnostic ListenerDiagnostics) {
+	e.diagnosticsLock.Lock()
+	defer e.diagnosticsLock.Unlock()
+
+	if e.diagnostics == nil {
+		e.diagnostics = make(map[string]ListenerDiagnostics)
+	}
+
+	e.diagnostics[id] = diagnostic
+}
+
+func (e *emitter) diagnosticFor(id string) (ListenerDiagnostics, bool) {
+	e.diagnosticsLock.Lock()
+	defer e.diagnosticsLock.Unlock()
+
+	diagnostic, ok := e.diagnostics[id]
+	return diagnostic, ok
+}
+
+func diagnosticError(diagnostic ListenerDiagnostics) error {
+	if diagnostic.Err != nil {
+		return diagnostic.Err
+	}
+
+	return errors.New(diagnostic.PanicStack)
+}
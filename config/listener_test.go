@@ -0,0 +1,86 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvokeConfigListeners(t *testing.T) {
+	t.Run("synchronous listener observes old and new config before returning", func(t *testing.T) {
+		var e emitter
+
+		var mu sync.Mutex
+		var observedOld, observedNew *model.Config
+
+		e.AddListenerWithOptions("sync", func(oldCfg, newCfg *model.Config) {
+			mu.Lock()
+			defer mu.Unlock()
+			observedOld, observedNew = oldCfg, newCfg
+		}, ListenerOptions{Synchronous: true})
+
+		oldCfg, newCfg := &model.Config{}, &model.Config{}
+		require.NoError(t, e.invokeConfigListeners(oldCfg, newCfg))
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Same(t, oldCfg, observedOld)
+		require.Same(t, newCfg, observedNew)
+	})
+
+	t.Run("panicking listener is isolated and recorded in diagnostics", func(t *testing.T) {
+		var e emitter
+
+		e.AddListenerWithOptions("panics", func(oldCfg, newCfg *model.Config) {
+			panic("boom")
+		}, ListenerOptions{Synchronous: true})
+
+		require.NoError(t, e.invokeConfigListeners(&model.Config{}, &model.Config{}))
+
+		diagnostics := e.ListenerDiagnostics()
+		require.Contains(t, diagnostics["panics"].PanicStack, "boom")
+	})
+
+	t.Run("slow listener times out and is recorded in diagnostics", func(t *testing.T) {
+		var e emitter
+
+		release := make(chan struct{})
+		defer close(release)
+
+		e.AddListenerWithOptions("slow", func(oldCfg, newCfg *model.Config) {
+			<-release
+		}, ListenerOptions{Synchronous: true, Timeout: 10 * time.Millisecond})
+
+		require.NoError(t, e.invokeConfigListeners(&model.Config{}, &model.Config{}))
+
+		diagnostics := e.ListenerDiagnostics()
+		require.Error(t, diagnostics["slow"].Err)
+	})
+
+	t.Run("failing critical listener rolls back by returning an error", func(t *testing.T) {
+		var e emitter
+
+		e.AddListenerWithOptions("critical", func(oldCfg, newCfg *model.Config) {
+			panic("critical failure")
+		}, ListenerOptions{Critical: true})
+
+		err := e.invokeConfigListeners(&model.Config{}, &model.Config{})
+		require.Error(t, err)
+	})
+
+	t.Run("non-critical listener failure does not roll back", func(t *testing.T) {
+		var e emitter
+
+		e.AddListenerWithOptions("noncritical", func(oldCfg, newCfg *model.Config) {
+			panic("not critical")
+		}, ListenerOptions{Synchronous: true})
+
+		require.NoError(t, e.invokeConfigListeners(&model.Config{}, &model.Config{}))
+	})
+}
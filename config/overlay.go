@@ -0,0 +1,144 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	declarativeOverlayJSONEnvVar = "MM_CONFIG_OVERWRITE_JSON"
+	declarativeOverlayFileEnvVar = "MM_CONFIG_OVERWRITE_FILE"
+)
+
+// ErrReadOnlyField is returned by set when the caller attempts to modify a field that is
+// pinned by an environment variable or a declarative overlay.
+type ErrReadOnlyField struct {
+	Path string
+}
+
+func (e *ErrReadOnlyField) Error() string {
+	return "configuration field " + e.Path + " is read-only"
+}
+
+// loadDeclarativeOverlay reads the declarative overlay from MM_CONFIG_OVERWRITE_JSON or
+// MM_CONFIG_OVERWRITE_FILE, if either is set. It returns a nil map if neither is configured.
+func loadDeclarativeOverlay() (map[string]interface{}, error) {
+	if raw := os.Getenv(declarativeOverlayJSONEnvVar); raw != "" {
+		return unmarshalOverlay([]byte(raw))
+	}
+
+	if path := os.Getenv(declarativeOverlayFileEnvVar); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", declarativeOverlayFileEnvVar)
+		}
+		return unmarshalOverlay(b)
+	}
+
+	return nil, nil
+}
+
+func unmarshalOverlay(b []byte) (map[string]interface{}, error) {
+	var overlay map[string]interface{}
+	if err := json.Unmarshal(b, &overlay); err != nil {
+		return nil, errors.Wrap(err, "failed to parse declarative config overlay")
+	}
+
+	return overlay, nil
+}
+
+// applyDeclarativeOverlay merges overlay onto target field-by-field, returning a map that
+// mirrors the shape of overlay with every applied leaf replaced by true, parallel to the map
+// produced for environment overrides.
+func applyDeclarativeOverlay(target reflect.Value, overlay map[string]interface{}) (map[string]interface{}, error) {
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	applied := make(map[string]interface{})
+
+	for key, value := range overlay {
+		field := target.FieldByName(key)
+		if !field.IsValid() {
+			return nil, errors.Errorf("unknown configuration field %s in declarative overlay", key)
+		}
+
+		nested, isNested := value.(map[string]interface{})
+		fieldTarget := field
+		if fieldTarget.Kind() == reflect.Ptr {
+			if fieldTarget.IsNil() {
+				fieldTarget.Set(reflect.New(fieldTarget.Type().Elem()))
+			}
+			fieldTarget = fieldTarget.Elem()
+		}
+
+		if isNested && fieldTarget.Kind() == reflect.Struct {
+			childApplied, err := applyDeclarativeOverlay(fieldTarget, nested)
+			if err != nil {
+				return nil, err
+			}
+			applied[key] = childApplied
+			continue
+		}
+
+		valueToSet := reflect.ValueOf(value)
+		if field.Kind() == reflect.Ptr && valueToSet.IsValid() {
+			ptr := reflect.New(field.Type().Elem())
+			if !valueToSet.Type().ConvertibleTo(field.Type().Elem()) {
+				return nil, errors.Errorf("value for %s is not assignable", key)
+			}
+			ptr.Elem().Set(valueToSet.Convert(field.Type().Elem()))
+			field.Set(ptr)
+		} else if valueToSet.IsValid() && valueToSet.Type().ConvertibleTo(field.Type()) {
+			field.Set(valueToSet.Convert(field.Type()))
+		} else {
+			return nil, errors.Errorf("value for %s is not assignable", key)
+		}
+
+		applied[key] = true
+	}
+
+	return applied, nil
+}
+
+// isPathOverridden reports whether the dot-path is pinned by the given overrides map, either
+// because the exact field was overridden or because an ancestor object was overridden wholesale.
+func isPathOverridden(path string, overrides map[string]interface{}) bool {
+	if len(overrides) == 0 {
+		return false
+	}
+
+	segments := strings.Split(path, ".")
+
+	node := interface{}(overrides)
+	for _, segment := range segments {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			// A prior segment was overridden wholesale (leaf value true), so everything
+			// beneath it is read-only too.
+			return true
+		}
+
+		next, ok := m[segment]
+		if !ok {
+			return false
+		}
+
+		node = next
+	}
+
+	if _, isMap := node.(map[string]interface{}); isMap {
+		// The path refers to an object, not a leaf; treat any nested override as covering it.
+		return true
+	}
+
+	return true
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDeclarativeOverlay(t *testing.T) {
+	t.Run("applies a leaf field and records it as overridden", func(t *testing.T) {
+		cfg := &model.Config{}
+		cfg.SetDefaults()
+
+		overlay := map[string]interface{}{
+			"SqlSettings": map[string]interface{}{
+				"DriverName": model.DATABASE_DRIVER_POSTGRES,
+			},
+		}
+
+		applied, err := applyDeclarativeOverlay(reflect.ValueOf(cfg), overlay)
+		require.NoError(t, err)
+		require.Equal(t, model.DATABASE_DRIVER_POSTGRES, *cfg.SqlSettings.DriverName)
+		require.Equal(t, map[string]interface{}{"DriverName": true}, applied["SqlSettings"])
+	})
+
+	t.Run("rejects an unknown field", func(t *testing.T) {
+		cfg := &model.Config{}
+		cfg.SetDefaults()
+
+		overlay := map[string]interface{}{"NotARealSetting": "value"}
+
+		_, err := applyDeclarativeOverlay(reflect.ValueOf(cfg), overlay)
+		require.Error(t, err)
+	})
+}
+
+func TestIsPathOverridden(t *testing.T) {
+	overrides := map[string]interface{}{
+		"SqlSettings": map[string]interface{}{
+			"DriverName": true,
+		},
+	}
+
+	require.True(t, isPathOverridden("SqlSettings.DriverName", overrides))
+	require.True(t, isPathOverridden("SqlSettings", overrides))
+	require.False(t, isPathOverridden("SqlSettings.DataSource", overrides))
+	require.False(t, isPathOverridden("FileSettings.PublicLinkSalt", overrides))
+	require.False(t, isPathOverridden("anything", nil))
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// Store abstracts the act of getting and setting the configuration, as well as watching for
+// changes and being notified of the environment and declarative overrides in effect. Any new
+// backing implementation must satisfy this interface.
+type Store interface {
+	// Get fetches the current, cached configuration.
+	Get() *model.Config
+
+	// GetEnvironmentOverrides fetches the configuration fields overridden by environment variables.
+	GetEnvironmentOverrides() map[string]interface{}
+
+	// GetDeclarativeOverrides fetches the configuration fields pinned by the declarative config
+	// overlay (MM_CONFIG_OVERWRITE_JSON or MM_CONFIG_OVERWRITE_FILE).
+	GetDeclarativeOverrides() map[string]interface{}
+
+	// Set replaces the current configuration in its entirety, without updating the backing store.
+	Set(*model.Config) (*model.Config, error)
+
+	// Load updates the current configuration from the backing store.
+	Load() error
+
+	// Save writes the current configuration to the backing store.
+	Save() error
+
+	// String returns the location of the backing store, masking any credentials.
+	String() string
+
+	// Close cleans up resources associated with the store.
+	Close() error
+
+	// AddListener adds a callback function to invoke when the configuration changes, returning
+	// a unique id that can later be passed to RemoveListener.
+	AddListener(listener Listener) string
+
+	// AddListenerWithOptions adds a callback function under the given id, customizing how it
+	// is dispatched via opts.
+	AddListenerWithOptions(id string, listener Listener, opts ListenerOptions)
+
+	// RemoveListener removes a callback function using an id returned from AddListener.
+	RemoveListener(id string)
+
+	// ListenerDiagnostics reports the last-run duration, error, and panic stack (if any)
+	// observed for each listener that has been dispatched to at least once.
+	ListenerDiagnostics() map[string]ListenerDiagnostics
+}
+
+// StoreFactory creates a new Store from the given DSN.
+type StoreFactory func(dsn string) (Store, error)
+
+var (
+	storeRegistryMutex sync.Mutex
+	storeRegistry      = make(map[string]StoreFactory)
+)
+
+// Register associates a DSN scheme (e.g. "etcd" for "etcd://...") with a factory responsible
+// for constructing a Store of that kind. Typically called from an init() function.
+func Register(scheme string, factory StoreFactory) {
+	storeRegistryMutex.Lock()
+	defer storeRegistryMutex.Unlock()
+
+	storeRegistry[scheme] = factory
+}
+
+// NewStoreFromDSN is the single entry point used by the app to construct a Store, dispatching
+// to whichever backend was registered for the DSN's scheme.
+func NewStoreFromDSN(dsn string) (Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse DSN as URL")
+	}
+
+	storeRegistryMutex.Lock()
+	factory, ok := storeRegistry[u.Scheme]
+	storeRegistryMutex.Unlock()
+
+	if !ok {
+		return nil, errors.Errorf("no config store registered for scheme %s", u.Scheme)
+	}
+
+	return factory(dsn)
+}
+
+func init() {
+	Register("mysql", func(dsn string) (Store, error) {
+		return NewDatabaseStore(dsn)
+	})
+	Register("postgres", func(dsn string) (Store, error) {
+		return NewDatabaseStore(dsn)
+	})
+	Register("etcd", func(dsn string) (Store, error) {
+		return NewEtcdStore(dsn)
+	})
+	Register("consul", func(dsn string) (Store, error) {
+		return NewConsulStore(dsn)
+	})
+}
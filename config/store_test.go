@@ -0,0 +1,58 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterAndNewStoreFromDSN(t *testing.T) {
+	t.Run("dispatches to the factory registered for the DSN's scheme", func(t *testing.T) {
+		var seenDSN string
+		Register("test-store-scheme", func(dsn string) (Store, error) {
+			seenDSN = dsn
+			return nil, nil
+		})
+
+		store, err := NewStoreFromDSN("test-store-scheme://somewhere")
+		require.NoError(t, err)
+		require.Nil(t, store)
+		require.Equal(t, "test-store-scheme://somewhere", seenDSN)
+	})
+
+	t.Run("a later registration for the same scheme replaces the earlier one", func(t *testing.T) {
+		Register("test-store-scheme-replace", func(dsn string) (Store, error) {
+			return nil, errors.New("old factory")
+		})
+		Register("test-store-scheme-replace", func(dsn string) (Store, error) {
+			return nil, errors.New("new factory")
+		})
+
+		_, err := NewStoreFromDSN("test-store-scheme-replace://somewhere")
+		require.EqualError(t, err, "new factory")
+	})
+
+	t.Run("unknown scheme returns an error", func(t *testing.T) {
+		_, err := NewStoreFromDSN("test-store-scheme-unknown://somewhere")
+		require.Error(t, err)
+	})
+
+	t.Run("malformed DSN returns an error", func(t *testing.T) {
+		_, err := NewStoreFromDSN("postgres://\x7f")
+		require.Error(t, err)
+	})
+
+	t.Run("the built-in schemes are registered", func(t *testing.T) {
+		for _, scheme := range []string{"mysql", "postgres", "etcd", "consul"} {
+			storeRegistryMutex.Lock()
+			_, ok := storeRegistry[scheme]
+			storeRegistryMutex.Unlock()
+
+			require.True(t, ok, "expected scheme %s to be registered", scheme)
+		}
+	})
+}